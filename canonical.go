@@ -0,0 +1,408 @@
+package xmldom
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+)
+
+// CanonicalOptions configures MarshalCanonical.
+type CanonicalOptions struct {
+	// Exclusive selects Exclusive XML Canonicalization (RFC 3741)
+	// instead of the inclusive form from the original XML-C14N spec:
+	// namespace declarations inherited from outside the canonicalized
+	// subtree are rendered only where a prefix they bind is actually
+	// used within that subtree.
+	Exclusive bool
+
+	// IncludeComments keeps comment nodes in the output ("C14N with
+	// comments"); by default they are dropped, along with any XML/DTD
+	// declarations.
+	IncludeComments bool
+
+	// InclusiveNamespacePrefixList names prefixes that must always be
+	// rendered on the subtree root even under Exclusive C14N. This is
+	// the InclusiveNamespaces PrefixList parameter used when signing a
+	// subtree that relies on an ancestor's declarations for something
+	// other than a qualified name (e.g. an xpath expression in text
+	// content).
+	InclusiveNamespacePrefixList []string
+}
+
+// MarshalCanonical serializes node using XML Canonicalization (C14N),
+// producing byte-identical output suitable for input to XML Signature:
+// UTF-8 with no BOM or XML declaration, "\n" line endings, attributes
+// sorted and always double-quoted, and namespace declarations emitted
+// only where the C14N algorithm selected by opts requires them. If node
+// is a Document, its DocumentElement is canonicalized, matching
+// Encoder's handling of a Document passed to Encode.
+func MarshalCanonical(node Node, opts CanonicalOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	c := &canonicalizer{w: &buf, opts: opts}
+
+	node = canonicalRoot(node)
+	if node == nil {
+		return buf.Bytes(), nil
+	}
+
+	rootScope := newRootScope()
+	if opts.Exclusive {
+		rootScope = ancestorScope(node)
+	}
+
+	if err := c.writeNode(node, rootScope, true); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// canonicalRoot returns the node that should actually be walked by
+// writeNode: node itself, or its DocumentElement if node is a
+// Document (which writeNode's NodeType switch has no case for, just as
+// Encoder never walks a Document node directly).
+func canonicalRoot(node Node) Node {
+	doc, ok := node.(Document)
+	if !ok {
+		return node
+	}
+	root := doc.DocumentElement()
+	if root == nil {
+		return nil
+	}
+	return root
+}
+
+type canonicalizer struct {
+	w    io.Writer
+	opts CanonicalOptions
+}
+
+// EncodeCanonical writes node to the stream using XML Canonicalization
+// instead of the encoder's regular indent/whitespace settings, so a
+// caller that already has an Encoder open on a target (e.g. a hash or
+// a signature buffer) can canonicalize without a separate MarshalCanonical
+// call and an extra copy.
+func (e *Encoder) EncodeCanonical(node Node, opts CanonicalOptions) error {
+	c := &canonicalizer{w: e.w, opts: opts}
+
+	node = canonicalRoot(node)
+	if node == nil {
+		return nil
+	}
+
+	rootScope := newRootScope()
+	if opts.Exclusive {
+		rootScope = ancestorScope(node)
+	}
+
+	return c.writeNode(node, rootScope, true)
+}
+
+// canonAttr holds the namespace URI, local name, resolved qualified
+// name and value of an attribute or namespace declaration, for sorting.
+type canonAttr struct {
+	uri, local, qname, value string
+}
+
+func (c *canonicalizer) writeNode(node Node, ns *nsScope, isRoot bool) error {
+	switch node.NodeType() {
+	case ELEMENT_NODE:
+		elem, ok := node.(Element)
+		if !ok {
+			return nil
+		}
+		return c.writeElement(elem, ns, isRoot)
+	case TEXT_NODE:
+		if text, ok := node.(Text); ok {
+			io.WriteString(c.w, escapeCanonicalText(string(text.Data())))
+		}
+	case CDATA_SECTION_NODE:
+		if cdata, ok := node.(CDATASection); ok {
+			io.WriteString(c.w, escapeCanonicalText(string(cdata.Data())))
+		}
+	case COMMENT_NODE:
+		if !c.opts.IncludeComments {
+			return nil
+		}
+		if comment, ok := node.(Comment); ok {
+			io.WriteString(c.w, "<!--"+normalizeLineEndings(string(comment.Data()))+"-->")
+		}
+	case PROCESSING_INSTRUCTION_NODE:
+		if pi, ok := node.(ProcessingInstruction); ok {
+			s := "<?" + string(pi.Target())
+			if data := string(pi.Data()); data != "" {
+				s += " " + normalizeLineEndings(data)
+			}
+			io.WriteString(c.w, s+"?>")
+		}
+		// XML/DTD declarations carry no node here and are dropped by
+		// construction: the encoder never writes one for canonical
+		// output in the first place.
+	}
+	return nil
+}
+
+func (c *canonicalizer) writeElement(elem Element, ns *nsScope, isRoot bool) error {
+	scope := ns.child()
+
+	uri := string(elem.NamespaceURI())
+	prefix := string(elem.Prefix())
+	qname := string(elem.TagName())
+	if uri != "" {
+		qname = string(elem.LocalName())
+		if prefix != "" {
+			qname = prefix + ":" + qname
+		}
+	}
+
+	// Visibly-utilized prefixes: the element's own, plus every
+	// attribute's. Exclusive C14N renders a namespace declaration only
+	// for these; the inclusive branch below declares each binding the
+	// element or its attributes need that is not yet in scope.
+	used := map[string]bool{}
+	if uri != "" {
+		used[prefix] = true
+	}
+
+	var attrs []canonAttr
+	attrEntries := elem.Attributes()
+	if attrEntries != nil {
+		for i := uint(0); i < attrEntries.Length(); i++ {
+			a := attrEntries.Item(i)
+			if a == nil || a.NodeType() != ATTRIBUTE_NODE {
+				continue
+			}
+			attrNode, ok := a.(Attr)
+			if !ok {
+				continue
+			}
+			aURI := string(attrNode.NamespaceURI())
+			aLocal := string(attrNode.LocalName())
+			aName := string(attrNode.Name())
+			aPrefix := string(attrNode.Prefix())
+			if aURI != "" {
+				used[aPrefix] = true
+				if aPrefix != "" {
+					aName = aPrefix + ":" + aLocal
+				}
+			}
+			attrs = append(attrs, canonAttr{uri: aURI, local: aLocal, qname: aName, value: string(attrNode.Value())})
+		}
+	}
+
+	if isRoot {
+		for _, p := range c.opts.InclusiveNamespacePrefixList {
+			used[p] = true
+		}
+	}
+
+	var declarations []canonAttr
+
+	// An ancestor's default namespace would otherwise apply to elem
+	// too: un-declare it so a namespace-less element nested under a
+	// default-namespaced ancestor round-trips correctly instead of
+	// silently inheriting that namespace on re-parse. This applies
+	// under both Exclusive and plain C14N.
+	if uri == "" && ns.defaultURI() != "" {
+		declarations = append(declarations, canonDecl("", ""))
+		scope.prefixes[""] = ""
+	}
+
+	if c.opts.Exclusive {
+		for p := range used {
+			if p == "" && uri == "" {
+				continue // handled by the un-declaration above
+			}
+			declURI, ok := declarationURI(elem, ns, p)
+			if !ok {
+				continue
+			}
+			if bound, ok := scope.uriForPrefix(p); ok && bound == declURI && !isRoot {
+				continue
+			}
+			declarations = append(declarations, canonDecl(p, declURI))
+			scope.prefixes[p] = declURI
+		}
+	} else {
+		// Inclusive C14N: declare every binding visible in ns at the
+		// subtree root and only new/overridden bindings below it.
+		// MarshalCanonical and EncodeCanonical start this mode from an
+		// empty scope, so bindings declared on ancestors outside the
+		// canonicalized node are not rendered unless the element or one
+		// of its attributes uses them.
+		for p, u := range allBindings(ns) {
+			if isRoot {
+				if p == "" && uri == "" {
+					continue // already un-declared above
+				}
+				declarations = append(declarations, canonDecl(p, u))
+				scope.prefixes[p] = u
+			}
+		}
+		if uri != "" {
+			if bound, ok := scope.uriForPrefix(prefix); !ok || bound != uri {
+				declarations = append(declarations, canonDecl(prefix, uri))
+				scope.prefixes[prefix] = uri
+			}
+		}
+		for _, a := range attrs {
+			if a.uri == "" {
+				continue
+			}
+			aPrefix := ""
+			if idx := strings.IndexByte(a.qname, ':'); idx >= 0 {
+				aPrefix = a.qname[:idx]
+			}
+			if bound, ok := scope.uriForPrefix(aPrefix); !ok || bound != a.uri {
+				declarations = append(declarations, canonDecl(aPrefix, a.uri))
+				scope.prefixes[aPrefix] = a.uri
+			}
+		}
+	}
+
+	sortCanonicalAttrs(declarations, attrs)
+
+	io.WriteString(c.w, "<"+qname)
+	for _, d := range declarations {
+		io.WriteString(c.w, " "+d.qname+`="`+escapeCanonicalAttr(d.value)+`"`)
+	}
+	for _, a := range attrs {
+		io.WriteString(c.w, " "+a.qname+`="`+escapeCanonicalAttr(a.value)+`"`)
+	}
+	io.WriteString(c.w, ">")
+
+	for child := elem.FirstChild(); child != nil; child = child.NextSibling() {
+		if err := c.writeNode(child, scope, false); err != nil {
+			return err
+		}
+	}
+
+	io.WriteString(c.w, "</"+qname+">")
+	return nil
+}
+
+func canonDecl(prefix, uri string) canonAttr {
+	name := "xmlns"
+	if prefix != "" {
+		name = "xmlns:" + prefix
+	}
+	return canonAttr{local: prefix, qname: name, value: uri}
+}
+
+// declarationURI resolves what URI prefix p is bound to at elem,
+// either because elem or one of its attributes carries that binding,
+// or because an ancestor scope already does.
+func declarationURI(elem Element, ns *nsScope, p string) (string, bool) {
+	if p == string(elem.Prefix()) && string(elem.NamespaceURI()) != "" {
+		return string(elem.NamespaceURI()), true
+	}
+	attrs := elem.Attributes()
+	if attrs != nil {
+		for i := uint(0); i < attrs.Length(); i++ {
+			if a, ok := attrs.Item(i).(Attr); ok && string(a.NamespaceURI()) != "" && string(a.Prefix()) == p {
+				return string(a.NamespaceURI()), true
+			}
+		}
+	}
+	return ns.uriForPrefix(p)
+}
+
+// allBindings flattens every prefix -> URI binding visible in scope,
+// innermost wins.
+func allBindings(scope *nsScope) map[string]string {
+	out := make(map[string]string)
+	chain := []*nsScope{}
+	for s := scope; s != nil; s = s.parent {
+		chain = append(chain, s)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for p, u := range chain[i].prefixes {
+			out[p] = u
+		}
+	}
+	return out
+}
+
+// ancestorScope reconstructs the namespace bindings in effect above
+// node by walking ParentNode(), so Exclusive C14N of a subtree can
+// still tell which prefixes it inherits rather than declares itself.
+func ancestorScope(node Node) *nsScope {
+	var chain []Element
+	for p := node.ParentNode(); p != nil; p = p.ParentNode() {
+		if elem, ok := p.(Element); ok {
+			chain = append(chain, elem)
+		}
+	}
+	scope := newRootScope()
+	for i := len(chain) - 1; i >= 0; i-- {
+		elem := chain[i]
+		scope = scope.child()
+		if uri := string(elem.NamespaceURI()); uri != "" {
+			scope.prefixes[string(elem.Prefix())] = uri
+		}
+		attrs := elem.Attributes()
+		if attrs != nil {
+			for i := uint(0); i < attrs.Length(); i++ {
+				if a, ok := attrs.Item(i).(Attr); ok {
+					if uri := string(a.NamespaceURI()); uri != "" {
+						scope.prefixes[string(a.Prefix())] = uri
+					}
+				}
+			}
+		}
+	}
+	return scope
+}
+
+// sortCanonicalAttrs orders namespace declarations before regular
+// attributes: default xmlns first, then prefixed xmlns:* sorted by
+// local name, then regular attributes sorted by namespace URI and then
+// local name, matching the C14N attribute-ordering rules.
+func sortCanonicalAttrs(declarations, attrs []canonAttr) {
+	sort.SliceStable(declarations, func(i, j int) bool {
+		if declarations[i].local == "" {
+			return declarations[j].local != ""
+		}
+		if declarations[j].local == "" {
+			return false
+		}
+		return declarations[i].local < declarations[j].local
+	})
+	sort.SliceStable(attrs, func(i, j int) bool {
+		if attrs[i].uri != attrs[j].uri {
+			return attrs[i].uri < attrs[j].uri
+		}
+		return attrs[i].local < attrs[j].local
+	})
+}
+
+func normalizeLineEndings(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\r", "\n")
+}
+
+// escapeCanonicalText escapes text node content per the C14N spec:
+// '&', '<', '>', and a bare '\r' (which must survive as a character
+// reference rather than being normalized away like "\r\n").
+func escapeCanonicalText(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	s = strings.ReplaceAll(s, ">", "&gt;")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "&#xD;")
+	return s
+}
+
+// escapeCanonicalAttr escapes an attribute value per the C14N spec:
+// always double-quoted, with '&', '<', '"', '\t', '\n', and '\r'
+// escaped as entity/character references.
+func escapeCanonicalAttr(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	s = strings.ReplaceAll(s, `"`, "&quot;")
+	s = strings.ReplaceAll(s, "\t", "&#x9;")
+	s = strings.ReplaceAll(s, "\n", "&#xA;")
+	s = strings.ReplaceAll(s, "\r", "&#xD;")
+	return s
+}
@@ -0,0 +1,34 @@
+package xmldom
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMarshalCanonicalUndeclaresDefaultNamespace mirrors
+// TestEncodeUndeclaresDefaultNamespace for C14N output: a namespace-less
+// element nested under a default-namespaced ancestor must un-declare
+// that namespace with xmlns="" so canonicalization stays
+// semantics-preserving, which is the entire point of C14N.
+func TestMarshalCanonicalUndeclaresDefaultNamespace(t *testing.T) {
+	doc := NewDocument()
+	root := doc.CreateElementNS("urn:example:ns", "root")
+	if _, err := doc.AppendChild(root); err != nil {
+		t.Fatalf("AppendChild(root): %v", err)
+	}
+
+	child := doc.CreateElement("plain")
+	if _, err := root.AppendChild(child); err != nil {
+		t.Fatalf("AppendChild(child): %v", err)
+	}
+
+	for _, exclusive := range []bool{true, false} {
+		out, err := MarshalCanonical(doc, CanonicalOptions{Exclusive: exclusive})
+		if err != nil {
+			t.Fatalf("MarshalCanonical(Exclusive=%v): %v", exclusive, err)
+		}
+		if !strings.Contains(string(out), `<plain xmlns="">`) {
+			t.Errorf("Exclusive=%v: output missing xmlns=\"\" un-declaration on <plain>: %s", exclusive, out)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package xmldom
+
+// Marshaler is implemented by types that know how to marshal themselves
+// into a DOM Node, analogous to encoding/xml.Marshaler. Marshal checks
+// for this interface before falling back to struct-tag reflection or
+// encoding/xml, so a domain type (e.g. SCXML executable content) can
+// control exactly how it appears in the tree.
+type Marshaler interface {
+	MarshalXMLDOM(doc Document) (Node, error)
+}
+
+// Unmarshaler is implemented by types that know how to populate
+// themselves from a DOM Node, analogous to encoding/xml.Unmarshaler.
+type Unmarshaler interface {
+	UnmarshalXMLDOM(node Node) error
+}
+
+// TextMarshaler is implemented by types that marshal to a plain string
+// suitable for use as element text content or an attribute value. It is
+// the DOM equivalent of encoding/xml.MarshalerAttr, but usable in
+// either position since xmldom doesn't distinguish the two interfaces.
+type TextMarshaler interface {
+	MarshalXMLDOMText() (string, error)
+}
+
+// TextUnmarshaler is implemented by types that populate themselves from
+// a plain string taken from element text content or an attribute
+// value.
+type TextUnmarshaler interface {
+	UnmarshalXMLDOMText(s string) error
+}
+
+// resolveMarshaler returns the Node a Marshaler produces in place of
+// node, when node implements Marshaler. The tree walk in
+// serializeNodeWithOptions calls this for every node, not just the
+// top-level value passed to Marshal, so a domain type embedded deep in
+// a larger document (e.g. a <script> element that wants its body
+// serialized as a CDATA section) still gets to control its own
+// serialization.
+func resolveMarshaler(node Node) (Node, error) {
+	m, ok := node.(Marshaler)
+	if !ok {
+		return node, nil
+	}
+	return m.MarshalXMLDOM(node.OwnerDocument())
+}
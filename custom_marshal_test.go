@@ -0,0 +1,129 @@
+package xmldom
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// wrappedValue is a minimal Marshaler/Unmarshaler round-trip through
+// the top-level Marshal/Unmarshal entry points.
+type wrappedValue struct {
+	Title string
+}
+
+func (w *wrappedValue) MarshalXMLDOM(doc Document) (Node, error) {
+	elem := doc.CreateElement("wrapped")
+	if _, err := elem.AppendChild(doc.CreateTextNode(w.Title)); err != nil {
+		return nil, err
+	}
+	return elem, nil
+}
+
+func (w *wrappedValue) UnmarshalXMLDOM(node Node) error {
+	elem, ok := node.(Element)
+	if !ok {
+		return fmt.Errorf("wrappedValue: node is not an element")
+	}
+	w.Title = elementCharData(elem)
+	return nil
+}
+
+func TestMarshalerUnmarshalerRoundTrip(t *testing.T) {
+	w := &wrappedValue{Title: "hello"}
+	data, err := Marshal(w)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !strings.Contains(string(data), "<wrapped>hello</wrapped>") {
+		t.Fatalf("Marshal output = %s, want it to contain <wrapped>hello</wrapped>", data)
+	}
+
+	var got wrappedValue
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.Title != w.Title {
+		t.Errorf("round-tripped Title = %q, want %q", got.Title, w.Title)
+	}
+}
+
+// nameValue is a minimal TextMarshaler/TextUnmarshaler round-trip.
+type nameValue struct {
+	Name, Value string
+}
+
+func (n *nameValue) MarshalXMLDOMText() (string, error) {
+	return n.Name + "=" + n.Value, nil
+}
+
+func (n *nameValue) UnmarshalXMLDOMText(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("nameValue: invalid encoding %q", s)
+	}
+	n.Name, n.Value = parts[0], parts[1]
+	return nil
+}
+
+func TestTextMarshalerUnmarshalerRoundTrip(t *testing.T) {
+	nv := &nameValue{Name: "k", Value: "v"}
+	data, err := Marshal(nv)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(data) != "k=v" {
+		t.Fatalf("Marshal output = %q, want %q", data, "k=v")
+	}
+
+	var got nameValue
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got != *nv {
+		t.Errorf("round-tripped value = %+v, want %+v", got, *nv)
+	}
+}
+
+// cdataScript is the scenario chunk0-3's own request names: a <script>
+// element that wants its body emitted as a CDATA section, even when
+// it's nested inside a larger document rather than passed directly to
+// Marshal. It embeds Element so it satisfies Node (and Element) via
+// promotion from a real placeholder, while MarshalXMLDOM lets it
+// override how it actually serializes.
+type cdataScript struct {
+	Element
+	body string
+}
+
+func (s *cdataScript) MarshalXMLDOM(doc Document) (Node, error) {
+	elem := doc.CreateElement("script")
+	if _, err := elem.AppendChild(doc.CreateCDATASection(s.body)); err != nil {
+		return nil, err
+	}
+	return elem, nil
+}
+
+func TestMarshalerAppliesToDescendantNode(t *testing.T) {
+	doc := NewDocument()
+	root := doc.CreateElement("page")
+	if _, err := doc.AppendChild(root); err != nil {
+		t.Fatalf("AppendChild(root): %v", err)
+	}
+
+	placeholder := doc.CreateElement("script")
+	script := &cdataScript{Element: placeholder, body: "if (a < b) { alert('hi'); }"}
+	if _, err := root.AppendChild(script); err != nil {
+		t.Fatalf("AppendChild(script): %v", err)
+	}
+
+	out, err := Marshal(doc)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	want := `<script><![CDATA[if (a < b) { alert('hi'); }]]></script>`
+	if !strings.Contains(string(out), want) {
+		t.Errorf("output = %s, want it to contain %s", out, want)
+	}
+}
@@ -0,0 +1,109 @@
+package xmldom
+
+import (
+	"bytes"
+	"encoding/xml"
+)
+
+// XMLDeclaration configures the "<?xml ...?>" declaration an Encoder
+// writes ahead of a Document, letting callers add an encoding or
+// standalone attribute, or suppress the declaration entirely (needed
+// for XML fragments embedded in a SOAP body or a signed subtree).
+//
+// To replay the declaration a document was parsed with instead of
+// authoring one by hand, get it from DecodeWithDeclaration rather than
+// UnmarshalDOM and pass it through as EncoderOptions.XMLDeclaration.
+type XMLDeclaration struct {
+	// Version defaults to "1.0" when empty.
+	Version string
+	// Encoding, if non-empty, is written as the encoding attribute.
+	Encoding string
+	// Standalone, if non-nil, is written as the standalone attribute
+	// ("yes" or "no").
+	Standalone *bool
+	// Omit suppresses the declaration entirely.
+	Omit bool
+}
+
+// String renders the declaration, or "" if it should be omitted. A nil
+// *XMLDeclaration renders the same bare declaration Encoder has always
+// written, so existing callers see no change in behavior.
+func (d *XMLDeclaration) String() string {
+	if d == nil {
+		return `<?xml version="1.0"?>`
+	}
+	if d.Omit {
+		return ""
+	}
+
+	version := d.Version
+	if version == "" {
+		version = "1.0"
+	}
+
+	s := `<?xml version="` + version + `"`
+	if d.Encoding != "" {
+		s += ` encoding="` + d.Encoding + `"`
+	}
+	if d.Standalone != nil {
+		if *d.Standalone {
+			s += ` standalone="yes"`
+		} else {
+			s += ` standalone="no"`
+		}
+	}
+	return s + "?>"
+}
+
+// DecodeWithDeclaration parses data the same way UnmarshalDOM does, but
+// also returns the leading "<?xml ...?>" declaration, if any, so a
+// caller that needs to replay it later doesn't have to author one by
+// hand: pass the result straight through as
+// EncoderOptions.XMLDeclaration. Returns a nil *XMLDeclaration if data
+// has no declaration.
+func DecodeWithDeclaration(data []byte) (Document, *XMLDeclaration, error) {
+	tokenizer := xml.NewDecoder(bytes.NewReader(data))
+	var decl *XMLDeclaration
+	for {
+		tok, err := tokenizer.Token()
+		if err != nil {
+			break
+		}
+		if pi, ok := tok.(xml.ProcInst); ok && pi.Target == "xml" {
+			decl = parseXMLDeclaration(string(pi.Inst))
+		}
+		break
+	}
+
+	doc, err := UnmarshalDOM(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, decl, nil
+}
+
+// parseXMLDeclaration parses the attribute text of an "xml" ProcInst
+// token (e.g. `version="1.0" encoding="UTF-8" standalone="yes"`) by
+// reusing encoding/xml's own attribute parsing on a synthetic start
+// tag, rather than hand-rolling quote/equals splitting.
+func parseXMLDeclaration(inst string) *XMLDeclaration {
+	var attrs struct {
+		Version    string `xml:"version,attr"`
+		Encoding   string `xml:"encoding,attr"`
+		Standalone string `xml:"standalone,attr"`
+	}
+	if err := xml.Unmarshal([]byte("<d "+inst+"></d>"), &attrs); err != nil {
+		return nil
+	}
+
+	decl := &XMLDeclaration{Version: attrs.Version, Encoding: attrs.Encoding}
+	switch attrs.Standalone {
+	case "yes":
+		t := true
+		decl.Standalone = &t
+	case "no":
+		f := false
+		decl.Standalone = &f
+	}
+	return decl
+}
@@ -0,0 +1,37 @@
+package xmldom
+
+import "testing"
+
+func TestDecodeWithDeclaration(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?><root/>`)
+
+	doc, decl, err := DecodeWithDeclaration(data)
+	if err != nil {
+		t.Fatalf("DecodeWithDeclaration: %v", err)
+	}
+	if doc.DocumentElement() == nil {
+		t.Fatal("DocumentElement() = nil")
+	}
+	if decl == nil {
+		t.Fatal("decl = nil, want a parsed declaration")
+	}
+	if decl.Version != "1.0" {
+		t.Errorf("Version = %q, want %q", decl.Version, "1.0")
+	}
+	if decl.Encoding != "UTF-8" {
+		t.Errorf("Encoding = %q, want %q", decl.Encoding, "UTF-8")
+	}
+	if decl.Standalone == nil || !*decl.Standalone {
+		t.Errorf("Standalone = %v, want true", decl.Standalone)
+	}
+}
+
+func TestDecodeWithDeclarationNoDeclaration(t *testing.T) {
+	_, decl, err := DecodeWithDeclaration([]byte(`<root/>`))
+	if err != nil {
+		t.Fatalf("DecodeWithDeclaration: %v", err)
+	}
+	if decl != nil {
+		t.Errorf("decl = %+v, want nil", decl)
+	}
+}
@@ -0,0 +1,539 @@
+package xmldom
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// Encoder writes XML data to an output stream, mirroring the shape of
+// encoding/xml.Encoder while understanding xmldom's DOM types. Unlike
+// Marshal/MarshalIndent, which buffer the entire result in memory via
+// bytes.Buffer, Encoder writes incrementally through a bufio.Writer so
+// large documents can be streamed to their destination.
+type Encoder struct {
+	w                  *bufio.Writer
+	prefix, indent     string
+	preserveWhitespace bool
+	options            EncoderOptions
+
+	// tokenScope and tokenStack track namespace scoping across
+	// EncodeToken calls, which (unlike the DOM path) see one token at a
+	// time rather than a tree it can recurse over.
+	tokenScope *nsScope
+	tokenStack []tokenFrame
+}
+
+// tokenFrame records what's needed to close out a StartElement seen by
+// EncodeToken: the qualified name written on the start tag (so the end
+// tag matches exactly, including any prefix EncodeToken generated) and
+// the scope in effect before that element was entered.
+type tokenFrame struct {
+	qname       string
+	parentScope *nsScope
+}
+
+// NewEncoder returns a new Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w: bufio.NewWriter(w),
+	}
+}
+
+// Indent sets the encoder to generate XML in which each DOM element
+// begins on a new line and is indented by one copy of indent per
+// nesting depth. prefix is not written for DOM nodes; it is only
+// passed, with indent, to encoding/xml.MarshalIndent for non-DOM
+// values given to Encode. EncodeToken output is not indented.
+func (e *Encoder) Indent(prefix, indent string) {
+	e.prefix = prefix
+	e.indent = indent
+}
+
+// SetOptions configures namespace handling for subsequent Encode calls,
+// most notably a caller-supplied map of namespace URI to preferred
+// prefix (e.g. so "xsi" and "xsd" come out pinned instead of generated
+// as "ns1", "ns2").
+func (e *Encoder) SetOptions(opts EncoderOptions) {
+	e.options = opts
+}
+
+// Encode writes the XML encoding of v to the stream. v may be a DOM
+// Document, Element, or any other Node, in which case it is serialized
+// directly from the DOM tree, or any value accepted by
+// encoding/xml.Marshal, in which case it is delegated to the standard
+// library and copied through.
+//
+// Unlike encoding/xml.Encoder.Encode, this does not flush the
+// underlying writer — see Flush.
+func (e *Encoder) Encode(v interface{}) error {
+	if doc, ok := v.(Document); ok {
+		return e.encodeDocument(doc)
+	}
+	if elem, ok := v.(Element); ok {
+		return e.encodeNode(elem)
+	}
+	if node, ok := v.(Node); ok {
+		return e.encodeNode(node)
+	}
+
+	data, err := xml.MarshalIndent(v, e.prefix, e.indent)
+	if err != nil {
+		return err
+	}
+	if _, err := e.w.Write(data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *Encoder) encodeDocument(doc Document) error {
+	if s := e.options.XMLDeclaration.String(); s != "" {
+		if _, err := io.WriteString(e.w, s); err != nil {
+			return err
+		}
+		if e.indent != "" {
+			if _, err := io.WriteString(e.w, "\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	root := doc.DocumentElement()
+	if root == nil {
+		return nil
+	}
+
+	return serializeNodeWithOptions(e.w, root, e.prefix, e.indent, 0, e.preserveWhitespace, newRootScope(), &e.options)
+}
+
+func (e *Encoder) encodeNode(node Node) error {
+	return serializeNodeWithOptions(e.w, node, e.prefix, e.indent, 0, e.preserveWhitespace, newRootScope(), &e.options)
+}
+
+// EncodeToken writes the given XML token to the stream, for callers
+// that want to build a document from a hand-rolled event stream rather
+// than an in-memory DOM, the same way they would drive an
+// encoding/xml.Encoder. A StartElement/EndElement's Name.Space is
+// resolved against namespace declarations the same way the DOM path
+// resolves Element.NamespaceURI(), generating or reusing a prefix
+// (honoring EncoderOptions.Prefixes) as needed.
+//
+// Unlike encoding/xml.Encoder.Encode, this does not flush the
+// underlying writer — see Flush.
+func (e *Encoder) EncodeToken(t xml.Token) error {
+	switch tok := t.(type) {
+	case xml.StartElement:
+		if e.tokenScope == nil {
+			e.tokenScope = newRootScope()
+		}
+		qname, declarations, childScope := resolveTokenElementName(tok.Name, e.tokenScope, &e.options)
+
+		if _, err := io.WriteString(e.w, "<"+qname); err != nil {
+			return err
+		}
+		for _, decl := range declarations {
+			if _, err := io.WriteString(e.w, " "+decl); err != nil {
+				return err
+			}
+		}
+		for _, attr := range tok.Attr {
+			attrName, attrDecl := resolveTokenAttrName(attr, childScope, &e.options)
+			if attrDecl != "" {
+				if _, err := io.WriteString(e.w, " "+attrDecl); err != nil {
+					return err
+				}
+			}
+			if _, err := io.WriteString(e.w, " "+attrName+`="`+EscapeString(attr.Value)+`"`); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(e.w, ">"); err != nil {
+			return err
+		}
+
+		e.tokenStack = append(e.tokenStack, tokenFrame{qname: qname, parentScope: e.tokenScope})
+		e.tokenScope = childScope
+		return nil
+	case xml.EndElement:
+		qname := tok.Name.Local
+		if n := len(e.tokenStack); n > 0 {
+			frame := e.tokenStack[n-1]
+			e.tokenStack = e.tokenStack[:n-1]
+			e.tokenScope = frame.parentScope
+			qname = frame.qname
+		}
+		_, err := io.WriteString(e.w, "</"+qname+">")
+		return err
+	case xml.CharData:
+		_, err := io.WriteString(e.w, EscapeString(string(tok)))
+		return err
+	case xml.Comment:
+		_, err := io.WriteString(e.w, "<!--"+string(tok)+"-->")
+		return err
+	case xml.ProcInst:
+		s := "<?" + tok.Target
+		if len(tok.Inst) > 0 {
+			s += " " + string(tok.Inst)
+		}
+		_, err := io.WriteString(e.w, s+"?>")
+		return err
+	case xml.Directive:
+		_, err := io.WriteString(e.w, "<!"+string(tok)+">")
+		return err
+	}
+	return nil
+}
+
+// Flush flushes any buffered XML to the underlying io.Writer. Encode
+// and EncodeToken do not flush on their own so that a caller can
+// interleave both without forcing a write on every call; call Flush
+// once output is complete.
+func (e *Encoder) Flush() error {
+	return e.w.Flush()
+}
+
+// serializeElement serializes an Element and its children to XML.
+func serializeElement(w io.Writer, elem Element, skipRoot bool, prefix, indent string, depth int) error {
+	return serializeElementWithOptions(w, elem, skipRoot, prefix, indent, depth, false, newRootScope(), &EncoderOptions{})
+}
+
+// serializeElementWithOptions serializes an Element and its children to
+// XML with whitespace preservation option. ns carries the namespace
+// prefix bindings in scope at this point in the tree; any binding this
+// element's tag name or attributes require that isn't already in scope
+// is declared on the start tag and added to the scope passed to
+// children.
+func serializeElementWithOptions(w io.Writer, elem Element, skipRoot bool, prefix, indent string, depth int, preserveWhitespace bool, ns *nsScope, opts *EncoderOptions) error {
+	// Write indentation if indent is provided
+	if indent != "" && !skipRoot {
+		io.WriteString(w, strings.Repeat(indent, depth))
+	}
+
+	childScope := ns
+	var tagName string
+	var declarations []string
+
+	if !skipRoot {
+		tagName, declarations, childScope = resolveElementName(elem, ns, opts)
+
+		// Write opening tag
+		io.WriteString(w, "<")
+		io.WriteString(w, tagName)
+
+		for _, decl := range declarations {
+			io.WriteString(w, " ")
+			io.WriteString(w, decl)
+		}
+
+		// Write attributes
+		attrs := elem.Attributes()
+		if attrs != nil {
+			for i := uint(0); i < attrs.Length(); i++ {
+				attr := attrs.Item(i)
+				if attr != nil && attr.NodeType() == ATTRIBUTE_NODE {
+					if attrNode, ok := attr.(Attr); ok {
+						attrName, attrDecl := resolveAttrName(attrNode, childScope, opts)
+						if attrDecl != "" {
+							io.WriteString(w, " ")
+							io.WriteString(w, attrDecl)
+						}
+
+						io.WriteString(w, " ")
+						io.WriteString(w, attrName)
+
+						attrValue := string(attrNode.Value())
+						quote := byte('"')
+						if opts.AttributeQuoteStyle == SingleQuoteAttributes {
+							quote = '\''
+						}
+
+						io.WriteString(w, "=")
+						io.WriteString(w, string(quote))
+						if opts.AttributeQuoteStyle == SingleQuoteAttributes {
+							io.WriteString(w, escapeAttrValueSingleQuoted(attrValue))
+						} else {
+							io.WriteString(w, escapeAttrValueDoubleQuoted(attrValue))
+						}
+						io.WriteString(w, string(quote))
+					}
+				}
+			}
+		}
+
+		// Check if element has children
+		hasChildren := elem.HasChildNodes()
+		if !hasChildren {
+			// For SCXML conformance, always use explicit opening/closing tags
+			// instead of self-closing tags for empty elements
+			io.WriteString(w, "></")
+			io.WriteString(w, tagName)
+			io.WriteString(w, ">")
+			if indent != "" {
+				io.WriteString(w, "\n")
+			}
+			return nil
+		}
+
+		io.WriteString(w, ">")
+		if indent != "" && hasChildren {
+			io.WriteString(w, "\n")
+		}
+	}
+
+	// Serialize children
+	for child := elem.FirstChild(); child != nil; child = child.NextSibling() {
+		if err := serializeNodeWithOptions(w, child, prefix, indent, depth+1, preserveWhitespace, childScope, opts); err != nil {
+			return err
+		}
+	}
+
+	if !skipRoot {
+		// Write indentation for closing tag if indent is provided
+		if indent != "" {
+			io.WriteString(w, strings.Repeat(indent, depth))
+		}
+		// Write closing tag
+		io.WriteString(w, "</")
+		io.WriteString(w, tagName)
+		io.WriteString(w, ">")
+		if indent != "" {
+			io.WriteString(w, "\n")
+		}
+	}
+
+	return nil
+}
+
+// resolveElementName returns the qualified name to write for elem's
+// start/end tags, any xmlns declarations that must be emitted on the
+// start tag, and the scope children should be serialized against.
+func resolveElementName(elem Element, ns *nsScope, opts *EncoderOptions) (string, []string, *nsScope) {
+	// Every element gets its own scope, even if it declares nothing
+	// itself, so that attribute prefixes generated below are never
+	// written into a scope shared with siblings or ancestors.
+	scope := ns.child()
+
+	uri := string(elem.NamespaceURI())
+	if uri == "" {
+		var declarations []string
+		// An ancestor's default namespace would otherwise apply here
+		// too: un-declare it so this element round-trips as
+		// namespace-less rather than being silently pulled into the
+		// parent's default namespace on re-parse.
+		if ns.defaultURI() != "" {
+			declarations = append(declarations, `xmlns=""`)
+			scope.prefixes[""] = ""
+		}
+		return string(elem.TagName()), declarations, scope
+	}
+
+	var declarations []string
+	prefix := string(elem.Prefix())
+
+	if prefix == "" {
+		if ns.defaultURI() != uri {
+			declarations = append(declarations, `xmlns="`+EscapeString(uri)+`"`)
+			scope.prefixes[""] = uri
+		}
+		return string(elem.LocalName()), declarations, scope
+	}
+
+	if bound, ok := ns.uriForPrefix(prefix); !ok || bound != uri {
+		declarations = append(declarations, `xmlns:`+prefix+`="`+EscapeString(uri)+`"`)
+		scope.prefixes[prefix] = uri
+	}
+	return prefix + ":" + string(elem.LocalName()), declarations, scope
+}
+
+// resolveAttrName returns the qualified name to write for attr and, if
+// its namespace URI isn't yet bound to a prefix in scope, the xmlns
+// declaration needed to bind one. Unlike elements, an unprefixed
+// attribute with a namespace URI is never placed in the default
+// namespace (per XML Namespaces 1.0, it would otherwise mean "no
+// namespace"), so resolveAttrName always picks or generates a prefix.
+func resolveAttrName(attr Attr, ns *nsScope, opts *EncoderOptions) (string, string) {
+	uri := string(attr.NamespaceURI())
+	if uri == "" {
+		return string(attr.Name()), ""
+	}
+
+	if prefix, ok := ns.prefixForURI(uri); ok {
+		return prefix + ":" + string(attr.LocalName()), ""
+	}
+
+	prefix, ok := opts.Prefixes[uri]
+	if !ok {
+		prefix = ns.generatePrefix()
+	}
+	ns.prefixes[prefix] = uri
+	return prefix + ":" + string(attr.LocalName()), `xmlns:` + prefix + `="` + EscapeString(uri) + `"`
+}
+
+// resolveTokenElementName is resolveElementName's counterpart for
+// EncodeToken's hand-rolled xml.Name, which (unlike a DOM Element) has
+// no separate Prefix to preserve: a namespaced name always reuses a
+// prefix already bound to its Space in scope, or otherwise picks or
+// generates one, the same way resolveAttrName does for attributes.
+func resolveTokenElementName(name xml.Name, ns *nsScope, opts *EncoderOptions) (string, []string, *nsScope) {
+	scope := ns.child()
+
+	uri := name.Space
+	if uri == "" {
+		var declarations []string
+		if ns.defaultURI() != "" {
+			declarations = append(declarations, `xmlns=""`)
+			scope.prefixes[""] = ""
+		}
+		return name.Local, declarations, scope
+	}
+
+	if prefix, ok := ns.prefixForURI(uri); ok {
+		return prefix + ":" + name.Local, nil, scope
+	}
+	if ns.defaultURI() == uri {
+		return name.Local, nil, scope
+	}
+
+	prefix, ok := opts.Prefixes[uri]
+	if !ok {
+		prefix = ns.generatePrefix()
+	}
+	scope.prefixes[prefix] = uri
+	return prefix + ":" + name.Local, []string{`xmlns:` + prefix + `="` + EscapeString(uri) + `"`}, scope
+}
+
+// resolveTokenAttrName is resolveAttrName's counterpart for
+// EncodeToken's hand-rolled xml.Attr.
+func resolveTokenAttrName(attr xml.Attr, ns *nsScope, opts *EncoderOptions) (string, string) {
+	uri := attr.Name.Space
+	if uri == "" {
+		return attr.Name.Local, ""
+	}
+
+	if prefix, ok := ns.prefixForURI(uri); ok {
+		return prefix + ":" + attr.Name.Local, ""
+	}
+
+	prefix, ok := opts.Prefixes[uri]
+	if !ok {
+		prefix = ns.generatePrefix()
+	}
+	ns.prefixes[prefix] = uri
+	return prefix + ":" + attr.Name.Local, `xmlns:` + prefix + `="` + EscapeString(uri) + `"`
+}
+
+// serializeNode serializes any DOM node to XML
+func serializeNode(w io.Writer, node Node, prefix, indent string, depth int) error {
+	return serializeNodeWithOptions(w, node, prefix, indent, depth, false, newRootScope(), &EncoderOptions{})
+}
+
+// serializeNodeWithOptions serializes any DOM node to XML with whitespace preservation option
+func serializeNodeWithOptions(w io.Writer, node Node, prefix, indent string, depth int, preserveWhitespace bool, ns *nsScope, opts *EncoderOptions) error {
+	replacement, err := resolveMarshaler(node)
+	if err != nil {
+		return err
+	}
+	node = replacement
+
+	switch node.NodeType() {
+	case ELEMENT_NODE:
+		if elem, ok := node.(Element); ok {
+			return serializeElementWithOptions(w, elem, false, prefix, indent, depth, preserveWhitespace, ns, opts)
+		}
+	case TEXT_NODE:
+		if text, ok := node.(Text); ok {
+			textData := string(text.Data())
+			// Skip whitespace-only text nodes when indenting
+			if indent != "" && strings.TrimSpace(textData) == "" {
+				return nil
+			}
+			if indent != "" {
+				io.WriteString(w, strings.Repeat(indent, depth))
+			}
+			if preserveWhitespace {
+				// Write text content without escaping whitespace characters
+				io.WriteString(w, textData)
+			} else {
+				// Use standard escaping for XML compliance
+				io.WriteString(w, EscapeString(textData))
+			}
+			if indent != "" {
+				io.WriteString(w, "\n")
+			}
+		}
+	case COMMENT_NODE:
+		if comment, ok := node.(Comment); ok {
+			if indent != "" {
+				io.WriteString(w, strings.Repeat(indent, depth))
+			}
+			io.WriteString(w, "<!--")
+			if preserveWhitespace {
+				io.WriteString(w, string(comment.Data()))
+			} else {
+				io.WriteString(w, EscapeString(string(comment.Data())))
+			}
+			io.WriteString(w, "-->")
+			if indent != "" {
+				io.WriteString(w, "\n")
+			}
+		}
+	case CDATA_SECTION_NODE:
+		if cdata, ok := node.(CDATASection); ok {
+			if indent != "" {
+				io.WriteString(w, strings.Repeat(indent, depth))
+			}
+			io.WriteString(w, "<![CDATA[")
+			io.WriteString(w, strings.ReplaceAll(string(cdata.Data()), "]]>", "]]]]><![CDATA[>"))
+			io.WriteString(w, "]]>")
+			if indent != "" {
+				io.WriteString(w, "\n")
+			}
+		}
+	case PROCESSING_INSTRUCTION_NODE:
+		if pi, ok := node.(ProcessingInstruction); ok {
+			if indent != "" {
+				io.WriteString(w, strings.Repeat(indent, depth))
+			}
+			io.WriteString(w, "<?")
+			io.WriteString(w, string(pi.Target()))
+			if data := string(pi.Data()); data != "" {
+				io.WriteString(w, " ")
+				io.WriteString(w, data)
+			}
+			io.WriteString(w, "?>")
+			if indent != "" {
+				io.WriteString(w, "\n")
+			}
+		}
+		// Skip other node types for now
+	}
+	return nil
+}
+
+// escapeAttrValueDoubleQuoted escapes an attribute value for use
+// inside double quotes per XML 1.0 §3.3.3: '&', '<', '"', and the
+// whitespace characters that would otherwise be normalized by a
+// conformant parser ('\r', '\n', '\t') are replaced with character
+// references so the value round-trips exactly.
+func escapeAttrValueDoubleQuoted(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	s = strings.ReplaceAll(s, `"`, "&quot;")
+	s = strings.ReplaceAll(s, "\r", "&#xD;")
+	s = strings.ReplaceAll(s, "\n", "&#xA;")
+	s = strings.ReplaceAll(s, "\t", "&#x9;")
+	return s
+}
+
+// escapeAttrValueSingleQuoted escapes an attribute value for use
+// inside single quotes. Only '\'', '&', and '<' need escaping in this
+// form; '"' is left as-is, which is the point of opting into it for
+// JSON-in-XML attribute values.
+func escapeAttrValueSingleQuoted(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	s = strings.ReplaceAll(s, "'", "&apos;")
+	return s
+}
@@ -0,0 +1,145 @@
+package xmldom
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+// TestEncodeUndeclaresDefaultNamespace covers the case chunk0-2's own
+// request calls out: a child element with no namespace of its own,
+// nested under a parent that declared a default namespace, must emit
+// xmlns="" so it doesn't silently inherit the parent's namespace when
+// re-parsed.
+func TestEncodeUndeclaresDefaultNamespace(t *testing.T) {
+	doc := NewDocument()
+	root := doc.CreateElementNS("urn:example:ns", "root")
+	if _, err := doc.AppendChild(root); err != nil {
+		t.Fatalf("AppendChild(root): %v", err)
+	}
+
+	child := doc.CreateElement("plain")
+	if _, err := root.AppendChild(child); err != nil {
+		t.Fatalf("AppendChild(child): %v", err)
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(doc); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, `<plain xmlns="">`) {
+		t.Errorf("output missing xmlns=\"\" un-declaration on <plain>: %s", out)
+	}
+}
+
+func TestEscapeAttrValueDoubleQuoted(t *testing.T) {
+	got := escapeAttrValueDoubleQuoted("a & b <c> \"d\"\r\n\t")
+	want := `a &amp; b &lt;c&gt; &quot;d&quot;&#xD;&#xA;&#x9;`
+	if got != want {
+		t.Errorf("escapeAttrValueDoubleQuoted = %q, want %q", got, want)
+	}
+}
+
+func TestEscapeAttrValueSingleQuoted(t *testing.T) {
+	got := escapeAttrValueSingleQuoted(`a & b <c> 'd' "e"`)
+	want := `a &amp; b &lt;c&gt; &apos;d&apos; "e"`
+	if got != want {
+		t.Errorf("escapeAttrValueSingleQuoted = %q, want %q", got, want)
+	}
+}
+
+// TestEncodeSplitsCDATATerminatorInBody pins the fix for CDATA content
+// that itself contains "]]>": naively copying it through would close the
+// section early and leave a dangling ">" outside any markup, producing
+// malformed XML. The encoder must split it into two CDATA sections.
+func TestEncodeSplitsCDATATerminatorInBody(t *testing.T) {
+	doc := NewDocument()
+	root := doc.CreateElement("root")
+	if _, err := doc.AppendChild(root); err != nil {
+		t.Fatalf("AppendChild(root): %v", err)
+	}
+	cdata := doc.CreateCDATASection("before ]]> after")
+	if _, err := root.AppendChild(cdata); err != nil {
+		t.Fatalf("AppendChild(cdata): %v", err)
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(doc); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	want := "<![CDATA[before ]]]]><![CDATA[> after]]>"
+	if got := buf.String(); !strings.Contains(got, want) {
+		t.Errorf("output = %q, want it to contain %q", got, want)
+	}
+}
+
+// TestEncodeTokenNamespacedName covers a hand-rolled token stream using
+// a namespaced xml.Name: EncodeToken must declare and apply a prefix
+// the same way the DOM path would for an equivalent Element, rather
+// than silently dropping Name.Space.
+func TestEncodeTokenNamespacedName(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+
+	start := xml.StartElement{
+		Name: xml.Name{Space: "urn:example:ns", Local: "root"},
+		Attr: []xml.Attr{{Name: xml.Name{Space: "urn:example:ns", Local: "id"}, Value: "1"}},
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		t.Fatalf("EncodeToken(start): %v", err)
+	}
+	if err := enc.EncodeToken(xml.EndElement{Name: start.Name}); err != nil {
+		t.Fatalf("EncodeToken(end): %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, `xmlns:ns1="urn:example:ns"`) {
+		t.Fatalf("output missing namespace declaration: %s", out)
+	}
+	if !strings.Contains(out, `<ns1:root`) || !strings.Contains(out, `</ns1:root>`) {
+		t.Errorf("output missing matching prefixed start/end tags: %s", out)
+	}
+	if !strings.Contains(out, `ns1:id="1"`) {
+		t.Errorf("output missing namespaced attribute: %s", out)
+	}
+}
+
+// TestEncodeTokenReusesPinnedPrefix covers EncoderOptions.Prefixes
+// pinning the prefix EncodeToken picks for a namespace URI, the same
+// way it pins one for the DOM attribute path.
+func TestEncodeTokenReusesPinnedPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetOptions(EncoderOptions{Prefixes: map[string]string{"urn:example:ns": "ex"}})
+
+	name := xml.Name{Space: "urn:example:ns", Local: "root"}
+	if err := enc.EncodeToken(xml.StartElement{Name: name}); err != nil {
+		t.Fatalf("EncodeToken(start): %v", err)
+	}
+	if err := enc.EncodeToken(xml.EndElement{Name: name}); err != nil {
+		t.Fatalf("EncodeToken(end): %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, `<ex:root xmlns:ex="urn:example:ns"></ex:root>`) {
+		t.Errorf("output = %q, want pinned ex: prefix", out)
+	}
+}
@@ -0,0 +1,611 @@
+package xmldom
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// MarshalToDOM converts v, which must be a struct or a pointer to one,
+// into a DOM Document using the same "xml" struct tags that
+// encoding/xml understands ("name,attr", "omitempty", ",chardata",
+// ",cdata", ",innerxml", ",any"), but builds the xmldom tree directly
+// rather than round-tripping through Marshal/UnmarshalDOM.
+func MarshalToDOM(v interface{}) (Document, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("xmldom: MarshalToDOM: nil %s", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("xmldom: MarshalToDOM: %s is not a struct", rv.Type())
+	}
+
+	doc := NewDocument()
+	root := doc.CreateElement(rootElementName(rv))
+	if err := marshalStructInto(doc, root, rv); err != nil {
+		return nil, err
+	}
+	if _, err := doc.AppendChild(root); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// UnmarshalFromDOM populates v, which must be a non-nil pointer to a
+// struct, from node using the same struct tags MarshalToDOM honors.
+func UnmarshalFromDOM(node Node, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("xmldom: UnmarshalFromDOM: v must be a non-nil pointer")
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("xmldom: UnmarshalFromDOM: %s is not a struct", rv.Type())
+	}
+
+	elem, ok := node.(Element)
+	if !ok {
+		return fmt.Errorf("xmldom: UnmarshalFromDOM: node is not an element")
+	}
+	return unmarshalStructFrom(elem, rv)
+}
+
+// xmlTag is a parsed "xml" struct tag, using the same vocabulary as
+// encoding/xml: name,attr,omitempty,chardata,cdata,innerxml,any.
+type xmlTag struct {
+	name      string
+	attr      bool
+	chardata  bool
+	cdata     bool
+	innerxml  bool
+	any       bool
+	omitempty bool
+}
+
+func parseXMLTag(tag, fieldName string) xmlTag {
+	parts := strings.Split(tag, ",")
+	t := xmlTag{name: parts[0]}
+	for _, p := range parts[1:] {
+		switch p {
+		case "attr":
+			t.attr = true
+		case "chardata":
+			t.chardata = true
+		case "cdata":
+			t.cdata = true
+		case "innerxml":
+			t.innerxml = true
+		case "any":
+			t.any = true
+		case "omitempty":
+			t.omitempty = true
+		}
+	}
+	if t.name == "" {
+		t.name = fieldName
+	}
+	return t
+}
+
+// rootElementName picks the element name MarshalToDOM gives the
+// document's root: the tag on an XMLName field if the struct has one,
+// otherwise the Go type name, matching encoding/xml's default.
+func rootElementName(rv reflect.Value) string {
+	if f, ok := rv.Type().FieldByName("XMLName"); ok {
+		if tag, ok := f.Tag.Lookup("xml"); ok {
+			if name := strings.Split(tag, ",")[0]; name != "" {
+				return name
+			}
+		}
+	}
+	return rv.Type().Name()
+}
+
+func marshalStructInto(doc Document, elem Element, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+		if field.Name == "XMLName" {
+			continue
+		}
+
+		tagStr, hasTag := field.Tag.Lookup("xml")
+		if hasTag && tagStr == "-" {
+			continue
+		}
+		tag := parseXMLTag(tagStr, field.Name)
+
+		fv := rv.Field(i)
+		if tag.omitempty && isEmptyValue(fv) {
+			continue
+		}
+
+		switch {
+		case tag.attr:
+			s, err := formatAttrValue(fv)
+			if err != nil {
+				return err
+			}
+			if err := elem.SetAttribute(tag.name, s); err != nil {
+				return err
+			}
+		case tag.chardata:
+			s, err := formatAttrValue(fv)
+			if err != nil {
+				return err
+			}
+			text := doc.CreateTextNode(s)
+			if _, err := elem.AppendChild(text); err != nil {
+				return err
+			}
+		case tag.cdata:
+			s, err := formatAttrValue(fv)
+			if err != nil {
+				return err
+			}
+			cdata := doc.CreateCDATASection(s)
+			if _, err := elem.AppendChild(cdata); err != nil {
+				return err
+			}
+		case tag.innerxml:
+			if err := appendInnerXML(doc, elem, formatValue(fv)); err != nil {
+				return err
+			}
+		case field.Anonymous && fv.Kind() == reflect.Struct && !hasTag:
+			if err := marshalStructInto(doc, elem, fv); err != nil {
+				return err
+			}
+		default:
+			if err := marshalFieldAsElement(doc, elem, tag.name, fv); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// marshalFieldAsElement appends one child element per item for a
+// slice (other than []byte, which is treated as scalar text), honors
+// Marshaler/TextMarshaler on the field's value, and otherwise either
+// recurses into a nested struct or writes the value as the child
+// element's text content.
+func marshalFieldAsElement(doc Document, parent Element, name string, fv reflect.Value) error {
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < fv.Len(); i++ {
+			if err := marshalFieldAsElement(doc, parent, name, fv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+
+	if m, ok := marshalerOf(fv); ok {
+		node, err := m.MarshalXMLDOM(doc)
+		if err != nil {
+			return err
+		}
+		_, err = parent.AppendChild(node)
+		return err
+	}
+	if tm, ok := textMarshalerOf(fv); ok {
+		s, err := tm.MarshalXMLDOMText()
+		if err != nil {
+			return err
+		}
+		return appendTextElement(doc, parent, name, s)
+	}
+
+	if fv.Kind() == reflect.Struct {
+		child := doc.CreateElement(name)
+		if err := marshalStructInto(doc, child, fv); err != nil {
+			return err
+		}
+		_, err := parent.AppendChild(child)
+		return err
+	}
+
+	return appendTextElement(doc, parent, name, formatValue(fv))
+}
+
+func appendTextElement(doc Document, parent Element, name, text string) error {
+	child := doc.CreateElement(name)
+	if text != "" {
+		if _, err := child.AppendChild(doc.CreateTextNode(text)); err != nil {
+			return err
+		}
+	}
+	_, err := parent.AppendChild(child)
+	return err
+}
+
+// appendInnerXML parses raw as an XML fragment and grafts its children
+// onto elem directly, for the ",innerxml" tag.
+func appendInnerXML(doc Document, elem Element, raw string) error {
+	if raw == "" {
+		return nil
+	}
+	frag, err := UnmarshalDOM([]byte("<xmldomInnerXML>" + raw + "</xmldomInnerXML>"))
+	if err != nil {
+		return err
+	}
+	root := frag.DocumentElement()
+	if root == nil {
+		return nil
+	}
+	for child := root.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		if _, err := elem.AppendChild(child); err != nil {
+			return err
+		}
+		child = next
+	}
+	return nil
+}
+
+func unmarshalStructFrom(elem Element, rv reflect.Value) error {
+	rt := rv.Type()
+
+	// Index child elements by local tag name up front so repeated
+	// elements feeding a slice field are easy to collect in order,
+	// while also keeping them in document order for the ",any"
+	// catch-all handled below.
+	var orderedChildren []Element
+	childrenByName := make(map[string][]Element)
+	for child := elem.FirstChild(); child != nil; child = child.NextSibling() {
+		if child.NodeType() == ELEMENT_NODE {
+			if ce, ok := child.(Element); ok {
+				name := elementLocalName(ce)
+				childrenByName[name] = append(childrenByName[name], ce)
+				orderedChildren = append(orderedChildren, ce)
+			}
+		}
+	}
+
+	// claimed tracks which element names another field already maps
+	// by name, so the ",any" field below only picks up what's left.
+	claimed := make(map[string]bool)
+	var anyField reflect.Value
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		if field.Name == "XMLName" {
+			continue
+		}
+
+		tagStr, hasTag := field.Tag.Lookup("xml")
+		if hasTag && tagStr == "-" {
+			continue
+		}
+		tag := parseXMLTag(tagStr, field.Name)
+		fv := rv.Field(i)
+
+		if tag.any {
+			// Handled in a second pass below, once every other
+			// field's claim on an element name is known.
+			anyField = fv
+			continue
+		}
+
+		switch {
+		case tag.attr:
+			if val := elem.GetAttribute(tag.name); val != "" {
+				if err := setAttrValue(fv, val); err != nil {
+					return err
+				}
+			}
+		case tag.chardata, tag.cdata:
+			if err := setAttrValue(fv, elementCharData(elem)); err != nil {
+				return err
+			}
+		case tag.innerxml:
+			if fv.Kind() == reflect.String {
+				raw, err := innerXML(elem)
+				if err != nil {
+					return err
+				}
+				fv.SetString(raw)
+			}
+		case field.Anonymous && fv.Kind() == reflect.Struct && !hasTag:
+			if err := unmarshalStructFrom(elem, fv); err != nil {
+				return err
+			}
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8:
+			claimed[tag.name] = true
+			matches := childrenByName[tag.name]
+			slice := reflect.MakeSlice(fv.Type(), len(matches), len(matches))
+			for i, m := range matches {
+				if err := unmarshalFieldFromElement(m, slice.Index(i)); err != nil {
+					return err
+				}
+			}
+			fv.Set(slice)
+		default:
+			claimed[tag.name] = true
+			matches := childrenByName[tag.name]
+			if len(matches) == 0 {
+				continue
+			}
+			if err := unmarshalFieldFromElement(matches[0], fv); err != nil {
+				return err
+			}
+		}
+	}
+
+	if anyField.IsValid() {
+		var leftover []Element
+		for _, c := range orderedChildren {
+			if !claimed[elementLocalName(c)] {
+				leftover = append(leftover, c)
+			}
+		}
+		if anyField.Kind() == reflect.Slice && anyField.Type().Elem().Kind() != reflect.Uint8 {
+			slice := reflect.MakeSlice(anyField.Type(), len(leftover), len(leftover))
+			for i, m := range leftover {
+				if err := unmarshalFieldFromElement(m, slice.Index(i)); err != nil {
+					return err
+				}
+			}
+			anyField.Set(slice)
+		} else if len(leftover) > 0 {
+			if err := unmarshalFieldFromElement(leftover[0], anyField); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func unmarshalFieldFromElement(elem Element, fv reflect.Value) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+
+	if fv.CanAddr() {
+		if u, ok := fv.Addr().Interface().(Unmarshaler); ok {
+			return u.UnmarshalXMLDOM(elem)
+		}
+		if tu, ok := fv.Addr().Interface().(TextUnmarshaler); ok {
+			return tu.UnmarshalXMLDOMText(elementCharData(elem))
+		}
+	}
+
+	if fv.Kind() == reflect.Struct {
+		return unmarshalStructFrom(elem, fv)
+	}
+	return setValue(fv, elementCharData(elem))
+}
+
+// elementLocalName returns elem's tag name with any namespace prefix
+// stripped, for matching against an untagged struct-tag name.
+func elementLocalName(elem Element) string {
+	if uri := string(elem.NamespaceURI()); uri != "" {
+		return string(elem.LocalName())
+	}
+	return string(elem.TagName())
+}
+
+// elementCharData concatenates elem's direct Text and CDATASection
+// children, the same content encoding/xml exposes for ",chardata".
+func elementCharData(elem Element) string {
+	var sb strings.Builder
+	for child := elem.FirstChild(); child != nil; child = child.NextSibling() {
+		switch child.NodeType() {
+		case TEXT_NODE:
+			if t, ok := child.(Text); ok {
+				sb.WriteString(string(t.Data()))
+			}
+		case CDATA_SECTION_NODE:
+			if c, ok := child.(CDATASection); ok {
+				sb.WriteString(string(c.Data()))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// innerXML serializes elem's children (but not elem itself) back to
+// XML text, for the ",innerxml" tag.
+func innerXML(elem Element) (string, error) {
+	var sb strings.Builder
+	for child := elem.FirstChild(); child != nil; child = child.NextSibling() {
+		data, err := Marshal(child)
+		if err != nil {
+			return "", err
+		}
+		sb.Write(data)
+	}
+	return sb.String(), nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// marshalerOf reports whether v, or a pointer to v when v is
+// addressable, implements Marshaler, so a child-element field with a
+// pointer-receiver MarshalXMLDOM is honored by marshalFieldAsElement.
+// Attr, chardata and cdata fields do not consult Marshaler; they only
+// honor TextMarshaler (see formatAttrValue).
+func marshalerOf(v reflect.Value) (Marshaler, bool) {
+	if v.CanInterface() {
+		if m, ok := v.Interface().(Marshaler); ok {
+			return m, true
+		}
+	}
+	if v.CanAddr() {
+		if m, ok := v.Addr().Interface().(Marshaler); ok {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// textMarshalerOf is marshalerOf's TextMarshaler counterpart.
+func textMarshalerOf(v reflect.Value) (TextMarshaler, bool) {
+	if v.CanInterface() {
+		if tm, ok := v.Interface().(TextMarshaler); ok {
+			return tm, true
+		}
+	}
+	if v.CanAddr() {
+		if tm, ok := v.Addr().Interface().(TextMarshaler); ok {
+			return tm, true
+		}
+	}
+	return nil, false
+}
+
+// formatAttrValue renders fv as text for a ",attr", ",chardata", or
+// ",cdata" field, honoring TextMarshaler the same way
+// marshalFieldAsElement honors it for child elements. A struct-typed
+// field that doesn't implement TextMarshaler is rejected outright
+// instead of silently falling back to formatValue's "%v", which would
+// produce noise like "{foo bar}" rather than meaningful text.
+func formatAttrValue(fv reflect.Value) (string, error) {
+	v := fv
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if tm, ok := textMarshalerOf(v); ok {
+		return tm.MarshalXMLDOMText()
+	}
+	if v.Kind() == reflect.Struct {
+		return "", fmt.Errorf("xmldom: MarshalToDOM: %s does not implement TextMarshaler, cannot use as attr/chardata/cdata", v.Type())
+	}
+	return formatValue(fv), nil
+}
+
+func formatValue(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes())
+		}
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// textUnmarshalerOf reports whether a pointer to v implements
+// TextUnmarshaler, the same check unmarshalFieldFromElement applies to
+// child-element fields.
+func textUnmarshalerOf(v reflect.Value) (TextUnmarshaler, bool) {
+	if v.CanAddr() {
+		if tu, ok := v.Addr().Interface().(TextUnmarshaler); ok {
+			return tu, true
+		}
+	}
+	return nil, false
+}
+
+// setAttrValue applies s to fv for a ",attr", ",chardata", or ",cdata"
+// field, honoring TextUnmarshaler the same way unmarshalFieldFromElement
+// honors it for child elements, and erroring on a struct-typed field
+// that implements neither: setValue's switch has no reflect.Struct
+// case, so without this check such a field would be silently left at
+// its zero value instead of failing loudly.
+func setAttrValue(fv reflect.Value, s string) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+	if tu, ok := textUnmarshalerOf(fv); ok {
+		return tu.UnmarshalXMLDOMText(s)
+	}
+	if fv.Kind() == reflect.Struct {
+		return fmt.Errorf("xmldom: UnmarshalFromDOM: %s does not implement TextUnmarshaler, cannot use as attr/chardata/cdata", fv.Type())
+	}
+	return setValue(fv, s)
+}
+
+func setValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+		}
+	}
+	return nil
+}
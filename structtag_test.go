@@ -0,0 +1,210 @@
+package xmldom
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarshalToDOMAttrChardataOmitemptySlice(t *testing.T) {
+	type Doc1 struct {
+		ID   string   `xml:"id,attr"`
+		Body string   `xml:",chardata"`
+		Tags []string `xml:"tag"`
+		Note string   `xml:"note,omitempty"`
+	}
+
+	v := Doc1{ID: "42", Body: "hello", Tags: []string{"a", "b"}}
+	doc, err := MarshalToDOM(v)
+	if err != nil {
+		t.Fatalf("MarshalToDOM: %v", err)
+	}
+
+	root := doc.DocumentElement()
+	if got := root.GetAttribute("id"); got != "42" {
+		t.Errorf("id attribute = %q, want %q", got, "42")
+	}
+
+	out, err := Marshal(doc)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if strings.Contains(string(out), "<note>") {
+		t.Errorf("output = %s, omitempty Note should be absent", out)
+	}
+
+	var got Doc1
+	if err := UnmarshalFromDOM(root, &got); err != nil {
+		t.Fatalf("UnmarshalFromDOM: %v", err)
+	}
+	if got.ID != v.ID || got.Body != v.Body || got.Note != v.Note {
+		t.Errorf("round-tripped value = %+v, want %+v", got, v)
+	}
+	if len(got.Tags) != len(v.Tags) {
+		t.Fatalf("Tags = %v, want %v", got.Tags, v.Tags)
+	}
+	for i := range v.Tags {
+		if got.Tags[i] != v.Tags[i] {
+			t.Errorf("Tags[%d] = %q, want %q", i, got.Tags[i], v.Tags[i])
+		}
+	}
+}
+
+func TestMarshalToDOMCDATAAndInnerXML(t *testing.T) {
+	type ScriptDoc struct {
+		Script string `xml:",cdata"`
+	}
+
+	v := ScriptDoc{Script: "a < b"}
+	doc, err := MarshalToDOM(v)
+	if err != nil {
+		t.Fatalf("MarshalToDOM: %v", err)
+	}
+	out, err := Marshal(doc)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !strings.Contains(string(out), "<![CDATA[a < b]]>") {
+		t.Fatalf("output = %s, want it to contain a CDATA section", out)
+	}
+
+	var got ScriptDoc
+	if err := UnmarshalFromDOM(doc.DocumentElement(), &got); err != nil {
+		t.Fatalf("UnmarshalFromDOM: %v", err)
+	}
+	if got.Script != v.Script {
+		t.Errorf("round-tripped Script = %q, want %q", got.Script, v.Script)
+	}
+
+	type RawDoc struct {
+		Raw string `xml:",innerxml"`
+	}
+
+	rv := RawDoc{Raw: "<a>1</a><b>2</b>"}
+	rdoc, err := MarshalToDOM(rv)
+	if err != nil {
+		t.Fatalf("MarshalToDOM: %v", err)
+	}
+	rout, err := Marshal(rdoc)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !strings.Contains(string(rout), "<a>1</a><b>2</b>") {
+		t.Fatalf("output = %s, want it to contain the raw inner XML", rout)
+	}
+
+	var rgot RawDoc
+	if err := UnmarshalFromDOM(rdoc.DocumentElement(), &rgot); err != nil {
+		t.Fatalf("UnmarshalFromDOM: %v", err)
+	}
+	if rgot.Raw != rv.Raw {
+		t.Errorf("round-tripped Raw = %q, want %q", rgot.Raw, rv.Raw)
+	}
+}
+
+func TestUnmarshalFromDOMAnyCatchAll(t *testing.T) {
+	type Widget struct {
+		Name  string `xml:"name"`
+		Color string `xml:"color"`
+	}
+	type Container struct {
+		Title string   `xml:"title"`
+		Rest  []Widget `xml:",any"`
+	}
+
+	doc := NewDocument()
+	root := doc.CreateElement("container")
+	if _, err := doc.AppendChild(root); err != nil {
+		t.Fatalf("AppendChild(root): %v", err)
+	}
+
+	title := doc.CreateElement("title")
+	if _, err := title.AppendChild(doc.CreateTextNode("catalog")); err != nil {
+		t.Fatalf("AppendChild(title text): %v", err)
+	}
+	if _, err := root.AppendChild(title); err != nil {
+		t.Fatalf("AppendChild(title): %v", err)
+	}
+
+	for _, w := range []Widget{{Name: "bolt", Color: "red"}, {Name: "nut", Color: "blue"}} {
+		elem := doc.CreateElement("widget")
+		name := doc.CreateElement("name")
+		if _, err := name.AppendChild(doc.CreateTextNode(w.Name)); err != nil {
+			t.Fatalf("AppendChild(name text): %v", err)
+		}
+		if _, err := elem.AppendChild(name); err != nil {
+			t.Fatalf("AppendChild(name): %v", err)
+		}
+		color := doc.CreateElement("color")
+		if _, err := color.AppendChild(doc.CreateTextNode(w.Color)); err != nil {
+			t.Fatalf("AppendChild(color text): %v", err)
+		}
+		if _, err := elem.AppendChild(color); err != nil {
+			t.Fatalf("AppendChild(color): %v", err)
+		}
+		if _, err := root.AppendChild(elem); err != nil {
+			t.Fatalf("AppendChild(widget): %v", err)
+		}
+	}
+
+	var got Container
+	if err := UnmarshalFromDOM(root, &got); err != nil {
+		t.Fatalf("UnmarshalFromDOM: %v", err)
+	}
+
+	if got.Title != "catalog" {
+		t.Errorf("Title = %q, want %q", got.Title, "catalog")
+	}
+	want := []Widget{{Name: "bolt", Color: "red"}, {Name: "nut", Color: "blue"}}
+	if len(got.Rest) != len(want) {
+		t.Fatalf("len(Rest) = %d, want %d", len(got.Rest), len(want))
+	}
+	for i := range want {
+		if got.Rest[i] != want[i] {
+			t.Errorf("Rest[%d] = %+v, want %+v", i, got.Rest[i], want[i])
+		}
+	}
+}
+
+func TestUnmarshalFromDOMAnyCatchAllSingleValue(t *testing.T) {
+	type Extra struct {
+		Key string `xml:"key,attr"`
+	}
+	type Record struct {
+		ID    string `xml:"id"`
+		Extra Extra  `xml:",any"`
+	}
+
+	doc := NewDocument()
+	root := doc.CreateElement("record")
+	if _, err := doc.AppendChild(root); err != nil {
+		t.Fatalf("AppendChild(root): %v", err)
+	}
+
+	id := doc.CreateElement("id")
+	if _, err := id.AppendChild(doc.CreateTextNode("42")); err != nil {
+		t.Fatalf("AppendChild(id text): %v", err)
+	}
+	if _, err := root.AppendChild(id); err != nil {
+		t.Fatalf("AppendChild(id): %v", err)
+	}
+
+	extra := doc.CreateElement("metadata")
+	if err := extra.SetAttribute("key", "priority"); err != nil {
+		t.Fatalf("SetAttribute: %v", err)
+	}
+	if _, err := root.AppendChild(extra); err != nil {
+		t.Fatalf("AppendChild(metadata): %v", err)
+	}
+
+	var got Record
+	if err := UnmarshalFromDOM(root, &got); err != nil {
+		t.Fatalf("UnmarshalFromDOM: %v", err)
+	}
+
+	if got.ID != "42" {
+		t.Errorf("ID = %q, want %q", got.ID, "42")
+	}
+	if got.Extra.Key != "priority" {
+		t.Errorf("Extra.Key = %q, want %q", got.Extra.Key, "priority")
+	}
+}